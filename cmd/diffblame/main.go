@@ -0,0 +1,196 @@
+// Command diffblame prints the commits (or, with -format=blame/json, the
+// per-line attribution) responsible for the changes between two points in a
+// git repository's history. It is a thin CLI over the pkg/diffblame engine.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+
+	"github.com/Helcaraxan/diffblame/pkg/diffblame"
+)
+
+var (
+	debug       = flag.Bool("debug", false, "Print debug output.")
+	beginRev    = flag.String("begin", "", "Commit from which to start the diff-blame.")
+	endRev      = flag.String("end", "", "Commit at which to end the diff-blame.")
+	cacheDir    = flag.String("cache-dir", "", "Directory in which to persist the last-commit cache between runs. Defaults to an in-memory cache.")
+	format      = flag.String("format", "plain", `Output format: "plain" (default, one line per commit), "blame" (per-line attribution of the diff hunks) or "json" (structured per-line attribution).`)
+	allRefs     = flag.Bool("all-refs", false, "Consider every ref (plus HEAD) as a potential end point, instead of just -end.")
+	renameScore = flag.Int("rename-score", 70, "Minimum similarity percentage (0-100) for two blobs to be considered a rename when following file history across renames.")
+	showRenames = flag.Bool("show-renames", false, "Annotate emitted commits with the renames their history crossed.")
+	jobs        = flag.Int("jobs", runtime.NumCPU(), "Number of goroutines used to explore the branches of merge commits concurrently.")
+
+	repo *git.Repository
+)
+
+func main() {
+	flag.Parse()
+
+	verbosity := 0
+	if *debug {
+		verbosity = 1
+	}
+	logger := funcr.New(func(prefix, args string) {
+		if prefix != "" {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", prefix, args)
+		} else {
+			fmt.Fprintln(os.Stderr, args)
+		}
+	}, funcr.Options{Verbosity: verbosity})
+
+	if err := run(logger); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(logger logr.Logger) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("could not detect current path: %w", err)
+	}
+
+	repo, err = git.Clone(memory.NewStorage(), nil, &git.CloneOptions{URL: wd})
+	if err != nil {
+		return fmt.Errorf("could not open repository in %q: %w", wd, err)
+	}
+
+	begin, err := resolveCommit(*beginRev)
+	if err != nil {
+		return err
+	}
+
+	var end *object.Commit
+	if *endRev == "" {
+		if !*allRefs {
+			return fmt.Errorf("the -end flag is required unless -all-refs is set")
+		}
+		end, err = resolveCommit("HEAD")
+	} else {
+		end, err = resolveCommit(*endRev)
+	}
+	if err != nil {
+		return err
+	}
+
+	engine := diffblame.NewEngine(repo, begin, end)
+	engine.Logger = logger
+	engine.RenameScore = *renameScore
+	engine.ShowRenames = *showRenames
+	engine.Jobs = *jobs
+
+	if *cacheDir != "" {
+		engine.Cache, err = diffblame.NewFileLastCommitCache(*cacheDir)
+		if err != nil {
+			return fmt.Errorf("could not set up on-disk last-commit cache in %q: %w", *cacheDir, err)
+		}
+	}
+
+	if *allRefs {
+		tips, err := diffblame.RefTips(repo)
+		if err != nil {
+			return fmt.Errorf("could not enumerate refs for -all-refs: %w", err)
+		}
+		engine.EndTips = tips
+	}
+
+	ctx := context.Background()
+	changes, err := engine.ChangedFiles(ctx)
+	if err != nil {
+		return fmt.Errorf("could not compute changed files: %w", err)
+	}
+
+	switch *format {
+	case "blame":
+		records, err := engine.Blame(changes)
+		if err != nil {
+			return fmt.Errorf("could not compute per-line blame: %w", err)
+		}
+		printBlameText(records)
+	case "json":
+		records, err := engine.Blame(changes)
+		if err != nil {
+			return fmt.Errorf("could not compute per-line blame: %w", err)
+		}
+		return printBlameJSON(records)
+	default:
+		commits, err := engine.Commits(ctx, changes)
+		if err != nil {
+			return fmt.Errorf("could not compute commits: %w", err)
+		}
+		for _, c := range commits {
+			fmt.Printf("%s > %- 30s %s %s\n", cutString(c.Hash.String(), 6), cutString(c.Committer.Name, 30), c.Committer.When.UTC().Format("02/01/06"), cutString(strings.Split(c.Message, "\n")[0], 80))
+			if *showRenames {
+				for _, r := range engine.Renames(c) {
+					fmt.Printf("    renamed %s\n", r)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func cutString(s string, l int) string {
+	if len(s) <= l {
+		return s
+	}
+	return s[:l]
+}
+
+func resolveCommit(refname string) (*object.Commit, error) {
+	if refname == "HEAD" {
+		head, err := repo.Head()
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve HEAD: %w", err)
+		}
+		refname = head.Hash().String()
+	}
+
+	if !plumbing.IsHash(refname) {
+		refname = strings.TrimPrefix(refname, "origin/")
+		ref, err := storer.ResolveReference(repo.Storer, plumbing.NewRemoteReferenceName("origin", refname))
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve reference %q: %w", refname, err)
+		} else if ref.Type() != plumbing.HashReference {
+			return nil, fmt.Errorf("reference %q was not resolved to a commit hash but to a reference of type %q", refname, ref.Type().String())
+		}
+		refname = ref.Hash().String()
+	}
+
+	c, err := repo.CommitObject(plumbing.NewHash(refname))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve commit %q: %w", refname, err)
+	}
+	return c, nil
+}
+
+func printBlameText(records []diffblame.BlameRecord) {
+	for _, r := range records {
+		fmt.Printf("%s%s %s %- 30s %s:%d\n", r.Side, cutString(r.Commit, 6), r.When.UTC().Format("02/01/06"), cutString(r.Author, 30), r.File, r.Line)
+	}
+}
+
+func printBlameJSON(records []diffblame.BlameRecord) error {
+	enc := json.NewEncoder(os.Stdout)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
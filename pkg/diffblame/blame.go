@@ -0,0 +1,150 @@
+package diffblame
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	fdiff "github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// BlameRecord attributes a single line of a diff hunk to the commit that
+// introduced (Side "+") or last wrote (Side "-") it.
+type BlameRecord struct {
+	File   string    `json:"file"`
+	Line   int       `json:"line"`
+	Side   string    `json:"side"`
+	Commit string    `json:"commit"`
+	Author string    `json:"author"`
+	When   time.Time `json:"when"`
+}
+
+// Blame produces the per-line attribution for every added and changed file
+// in cl, plus the removed lines of every changed and removed file. Added
+// lines are attributed using a blame of e.End; removed lines are attributed
+// using a blame of e.Begin, since that is the last commit at which the
+// removed content was still present.
+func (e *Engine) Blame(cl ChangeList) ([]BlameRecord, error) {
+	var records []BlameRecord
+
+	renamedFrom := make(map[string]string, len(cl.Renames))
+	renameSources := make(map[string]bool, len(cl.Renames))
+	for _, r := range cl.Renames {
+		renamedFrom[r.To] = r.From
+		renameSources[r.From] = true
+	}
+
+	for _, path := range append(append([]string{}, cl.Changed...), cl.Added...) {
+		added, removed := patchLineRanges(cl.Patches[path])
+
+		if len(added) > 0 {
+			recs, err := blameLines(e.End, path, path, "+", added)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, recs...)
+		}
+		if len(removed) > 0 {
+			// A renamed-and-modified file only exists under path (the
+			// rename's destination) in e.End; e.Begin still has it under the
+			// source path, which is what must be blamed for the removed
+			// side of the hunk.
+			beginPath := path
+			if from, ok := renamedFrom[path]; ok {
+				beginPath = from
+			}
+			recs, err := blameLines(e.Begin, beginPath, path, "-", removed)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, recs...)
+		}
+	}
+
+	for _, path := range cl.Removed {
+		// A rename's source path also appears in cl.Removed (ChangedFiles
+		// records it as both Added under the destination and Removed under
+		// the source), but its removed lines were already emitted above
+		// under the destination name; emitting them again here would
+		// duplicate every line of a renamed-and-modified file.
+		if renameSources[path] {
+			continue
+		}
+		_, removed := patchLineRanges(cl.Patches[path])
+		recs, err := blameLines(e.Begin, path, path, "-", removed)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, recs...)
+	}
+
+	return records, nil
+}
+
+// patchLineRanges walks the chunks of patch and returns the 1-based line
+// numbers, in the new file and the old file respectively, that were added
+// and removed by it.
+func patchLineRanges(patch fdiff.FilePatch) (added []int, removed []int) {
+	if patch == nil {
+		return nil, nil
+	}
+
+	var oldLine, newLine int
+	for _, chunk := range patch.Chunks() {
+		content := chunk.Content()
+		lines := strings.Split(content, "\n")
+		if len(lines) > 0 && lines[len(lines)-1] == "" {
+			lines = lines[:len(lines)-1]
+		}
+
+		switch chunk.Type() {
+		case fdiff.Equal:
+			oldLine += len(lines)
+			newLine += len(lines)
+		case fdiff.Add:
+			for range lines {
+				newLine++
+				added = append(added, newLine)
+			}
+		case fdiff.Delete:
+			for range lines {
+				oldLine++
+				removed = append(removed, oldLine)
+			}
+		}
+	}
+	return added, removed
+}
+
+// blameLines runs git.Blame on blamePath at commit and returns a BlameRecord
+// for every requested line number, tagged with side. displayPath is recorded
+// as the record's File instead of blamePath, since a renamed-and-modified
+// file must be blamed under its old name at e.Begin but should still be
+// reported under the name the rest of the ChangeList knows it by.
+func blameLines(commit *object.Commit, blamePath, displayPath string, side string, lines []int) ([]BlameRecord, error) {
+	result, err := git.Blame(commit, blamePath)
+	if err != nil {
+		return nil, fmt.Errorf("could not blame %q at %q: %w", blamePath, commit.Hash.String(), err)
+	}
+
+	var records []BlameRecord
+	for _, lineNo := range lines {
+		idx := lineNo - 1
+		if idx < 0 || idx >= len(result.Lines) {
+			continue
+		}
+
+		l := result.Lines[idx]
+		records = append(records, BlameRecord{
+			File:   displayPath,
+			Line:   lineNo,
+			Side:   side,
+			Commit: l.Hash.String(),
+			Author: l.Author,
+			When:   l.Date,
+		})
+	}
+	return records, nil
+}
@@ -0,0 +1,107 @@
+package diffblame
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// TestBlameRenamedAndModifiedFileOnlyEmitsRemovedLinesOnce exercises a file
+// that is both renamed and has a line removed in the same range: the file
+// appears in both cl.Added (under its destination path, as a rename target)
+// and cl.Removed (under its source path, since ChangedFiles records both
+// sides of a rename), so the removed line must only be attributed once, not
+// once under each name.
+func TestBlameRenamedAndModifiedFileOnlyEmitsRemovedLinesOnce(t *testing.T) {
+	repo, err := git.Init(memory.NewStorage(), memfs.New())
+	if err != nil {
+		t.Fatalf("could not init test repository: %v", err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("could not get worktree: %v", err)
+	}
+
+	sig := &object.Signature{Name: "test", Email: "test@example.com", When: time.Unix(0, 0)}
+	write := func(path, content string) {
+		f, err := wt.Filesystem.Create(path)
+		if err != nil {
+			t.Fatalf("could not create %q: %v", path, err)
+		}
+		if _, err := f.Write([]byte(content)); err != nil {
+			t.Fatalf("could not write %q: %v", path, err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatalf("could not close %q: %v", path, err)
+		}
+	}
+
+	write("foo.txt", "keep-1\nkeep-2\nkeep-3\nkeep-4\nremove-me\n")
+	if _, err := wt.Add("foo.txt"); err != nil {
+		t.Fatalf("could not stage foo.txt: %v", err)
+	}
+	beginHash, err := wt.Commit("add foo.txt", &git.CommitOptions{Author: sig})
+	if err != nil {
+		t.Fatalf("could not commit foo.txt: %v", err)
+	}
+
+	if err := wt.Filesystem.Remove("foo.txt"); err != nil {
+		t.Fatalf("could not remove foo.txt: %v", err)
+	}
+	write("bar.txt", "keep-1\nkeep-2\nkeep-3\nkeep-4\n")
+	if _, err := wt.Add("foo.txt"); err != nil {
+		t.Fatalf("could not stage removal of foo.txt: %v", err)
+	}
+	if _, err := wt.Add("bar.txt"); err != nil {
+		t.Fatalf("could not stage bar.txt: %v", err)
+	}
+	endHash, err := wt.Commit("rename foo.txt to bar.txt, drop a line", &git.CommitOptions{Author: sig})
+	if err != nil {
+		t.Fatalf("could not commit rename: %v", err)
+	}
+
+	begin, err := repo.CommitObject(beginHash)
+	if err != nil {
+		t.Fatalf("could not load begin commit: %v", err)
+	}
+	end, err := repo.CommitObject(endHash)
+	if err != nil {
+		t.Fatalf("could not load end commit: %v", err)
+	}
+
+	e := NewEngine(repo, begin, end)
+	cl, err := e.ChangedFiles(context.Background())
+	if err != nil {
+		t.Fatalf("ChangedFiles failed: %v", err)
+	}
+
+	records, err := e.Blame(cl)
+	if err != nil {
+		t.Fatalf("Blame failed: %v", err)
+	}
+
+	var removedUnderFoo, removedUnderBar int
+	for _, r := range records {
+		if r.Side != "-" {
+			continue
+		}
+		switch r.File {
+		case "foo.txt":
+			removedUnderFoo++
+		case "bar.txt":
+			removedUnderBar++
+		}
+	}
+
+	if removedUnderFoo != 0 {
+		t.Errorf("got %d removed-side records under the rename's source path foo.txt, want 0", removedUnderFoo)
+	}
+	if removedUnderBar != 1 {
+		t.Errorf("got %d removed-side records under bar.txt, want exactly 1", removedUnderBar)
+	}
+}
@@ -0,0 +1,109 @@
+package diffblame
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// LastCommitCache remembers, for a given (commit, path) pair, the hash of the
+// commit that last touched path at or before commit. The walk consults it
+// before recursing into a branch so that previously resolved sub-histories
+// do not need to be walked again.
+type LastCommitCache interface {
+	Get(commit plumbing.Hash, path string) (plumbing.Hash, bool)
+	Put(commit plumbing.Hash, path string, last plumbing.Hash)
+}
+
+func cacheKey(commit plumbing.Hash, path string) string {
+	return commit.String() + "\x00" + path
+}
+
+// memoryLastCommitCache is the default LastCommitCache implementation. It
+// keeps everything in memory for the lifetime of the process.
+type memoryLastCommitCache struct {
+	mu   sync.Mutex
+	data map[string]plumbing.Hash
+}
+
+// NewMemoryLastCommitCache returns a LastCommitCache that keeps everything in
+// memory for the lifetime of the process.
+func NewMemoryLastCommitCache() LastCommitCache {
+	return &memoryLastCommitCache{data: map[string]plumbing.Hash{}}
+}
+
+func (c *memoryLastCommitCache) Get(commit plumbing.Hash, path string) (plumbing.Hash, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h, ok := c.data[cacheKey(commit, path)]
+	return h, ok
+}
+
+func (c *memoryLastCommitCache) Put(commit plumbing.Hash, path string, last plumbing.Hash) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data[cacheKey(commit, path)] = last
+}
+
+// fileLastCommitCache is an on-disk LastCommitCache backed by a flat,
+// newline-delimited file inside a cache directory. It is loaded fully into
+// memory on construction and appends new entries to disk as they are
+// discovered, so that subsequent runs against the same repository can reuse
+// the work.
+type fileLastCommitCache struct {
+	*memoryLastCommitCache
+	fileMu sync.Mutex
+	file   *os.File
+}
+
+// NewFileLastCommitCache returns a LastCommitCache backed by a flat file
+// inside dir, creating dir if necessary. Entries already present in the file
+// are loaded eagerly; new entries are appended as they are discovered.
+func NewFileLastCommitCache(dir string) (LastCommitCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("could not create cache directory %q: %w", dir, err)
+	}
+
+	path := filepath.Join(dir, "lastcommit.cache")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open cache file %q: %w", path, err)
+	}
+
+	mem := &memoryLastCommitCache{data: map[string]plumbing.Hash{}}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Fields are tab-delimited, not space-delimited, because path is
+		// free-form and commonly contains spaces; only the two hashes are
+		// guaranteed tab-free, so splitting on the first and the last tab is
+		// safe even if path itself somehow contained one.
+		line := scanner.Text()
+		firstTab, lastTab := strings.IndexByte(line, '\t'), strings.LastIndexByte(line, '\t')
+		if firstTab < 0 || firstTab == lastTab {
+			continue
+		}
+		commit, p, last := line[:firstTab], line[firstTab+1:lastTab], line[lastTab+1:]
+		mem.data[cacheKey(plumbing.NewHash(commit), p)] = plumbing.NewHash(last)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read cache file %q: %w", path, err)
+	}
+
+	return &fileLastCommitCache{memoryLastCommitCache: mem, file: f}, nil
+}
+
+func (c *fileLastCommitCache) Put(commit plumbing.Hash, path string, last plumbing.Hash) {
+	if existing, ok := c.memoryLastCommitCache.Get(commit, path); ok && existing == last {
+		return
+	}
+	c.memoryLastCommitCache.Put(commit, path, last)
+
+	c.fileMu.Lock()
+	defer c.fileMu.Unlock()
+	fmt.Fprintf(c.file, "%s\t%s\t%s\n", commit.String(), path, last.String())
+}
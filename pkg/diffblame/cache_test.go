@@ -0,0 +1,73 @@
+package diffblame
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// TestFileLastCommitCacheRoundTrip checks that a path containing a space
+// survives a Put, process restart (a fresh NewFileLastCommitCache against
+// the same directory) and Get, rather than being split across the wrong
+// fields by the on-disk format.
+func TestFileLastCommitCacheRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+
+	commit := plumbing.NewHash("1111111111111111111111111111111111111111")
+	last := plumbing.NewHash("2222222222222222222222222222222222222222")
+	path := "my file with spaces.txt"
+
+	cache, err := NewFileLastCommitCache(dir)
+	if err != nil {
+		t.Fatalf("NewFileLastCommitCache failed: %v", err)
+	}
+	cache.Put(commit, path, last)
+
+	reloaded, err := NewFileLastCommitCache(dir)
+	if err != nil {
+		t.Fatalf("NewFileLastCommitCache (reload) failed: %v", err)
+	}
+	got, ok := reloaded.Get(commit, path)
+	if !ok {
+		t.Fatalf("Get(%q) after reload found nothing, wanted a cache hit", path)
+	}
+	if got != last {
+		t.Fatalf("Get(%q) after reload = %s, want %s", path, got, last)
+	}
+}
+
+// TestFileLastCommitCacheDedupesWrites checks that repeated Put calls for an
+// unchanged (commit, path, last) triple, including ones already loaded from
+// disk at construction time, do not keep growing the on-disk file.
+func TestFileLastCommitCacheDedupesWrites(t *testing.T) {
+	dir := t.TempDir()
+
+	commit := plumbing.NewHash("1111111111111111111111111111111111111111")
+	last := plumbing.NewHash("2222222222222222222222222222222222222222")
+	path := "tracked.txt"
+
+	cache, err := NewFileLastCommitCache(dir)
+	if err != nil {
+		t.Fatalf("NewFileLastCommitCache failed: %v", err)
+	}
+	cache.Put(commit, path, last)
+	cache.Put(commit, path, last)
+
+	reloaded, err := NewFileLastCommitCache(dir)
+	if err != nil {
+		t.Fatalf("NewFileLastCommitCache (reload) failed: %v", err)
+	}
+	reloaded.Put(commit, path, last)
+
+	data, err := os.ReadFile(filepath.Join(dir, "lastcommit.cache"))
+	if err != nil {
+		t.Fatalf("could not read cache file: %v", err)
+	}
+
+	const wantLine = "1111111111111111111111111111111111111111\ttracked.txt\t2222222222222222222222222222222222222222\n"
+	if got := string(data); got != wantLine {
+		t.Fatalf("cache file after redundant Puts = %q, want exactly one line %q", got, wantLine)
+	}
+}
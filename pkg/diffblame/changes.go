@@ -0,0 +1,103 @@
+package diffblame
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	fdiff "github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Rename records that a path was renamed between Engine.Begin and
+// Engine.End.
+type Rename struct {
+	From string
+	To   string
+}
+
+// ChangeList is the set of paths that changed between Engine.Begin and
+// Engine.End, split by kind. A renamed path is listed in Added under its
+// destination and in Removed under its source, and is also preserved as a
+// pair in Renames, so that callers do not lose the association between the
+// two sides of a rename.
+type ChangeList struct {
+	Added   []string
+	Removed []string
+	Changed []string
+	Renames []Rename
+
+	// Patches holds the fdiff.FilePatch for every path in Added, Removed
+	// and Changed, keyed by the path under which it appears in that slice
+	// (the destination path for Added/Changed, the source path for
+	// Removed).
+	Patches map[string]fdiff.FilePatch
+}
+
+func containsPath(path, substr string) bool {
+	return strings.Contains(path, substr)
+}
+
+// ChangedFiles computes the set of files added, removed, changed or renamed
+// between e.Begin and e.End.
+func (e *Engine) ChangedFiles(ctx context.Context) (ChangeList, error) {
+	beginTree, err := e.Begin.Tree()
+	if err != nil {
+		return ChangeList{}, fmt.Errorf("failed to find the tree object for begin commit %q: %w", e.Begin.Hash.String(), err)
+	}
+	endTree, err := e.End.Tree()
+	if err != nil {
+		return ChangeList{}, fmt.Errorf("failed to find the tree object for end commit %q: %w", e.End.Hash.String(), err)
+	}
+
+	diff, err := object.DiffTreeWithOptions(ctx, beginTree, endTree, &object.DiffTreeOptions{
+		DetectRenames: true,
+		RenameScore:   uint(e.RenameScore),
+		RenameLimit:   0,
+	})
+	if err != nil {
+		return ChangeList{}, fmt.Errorf("failed to compute the diff for range %s..%s: %w", e.Begin.Hash.String(), e.End.Hash.String(), err)
+	}
+
+	patch, err := diff.Patch()
+	if err != nil {
+		return ChangeList{}, fmt.Errorf("failed to transform the diff into a list of patches: %w", err)
+	}
+
+	cl := ChangeList{Patches: map[string]fdiff.FilePatch{}}
+	for _, fp := range patch.FilePatches() {
+		srcFile, dstFile := fp.Files()
+		switch {
+		case srcFile == nil:
+			if e.ignored(dstFile.Path()) {
+				continue
+			}
+			cl.Added = append(cl.Added, dstFile.Path())
+			cl.Patches[dstFile.Path()] = fp
+		case dstFile == nil:
+			if e.ignored(srcFile.Path()) {
+				continue
+			}
+			cl.Removed = append(cl.Removed, srcFile.Path())
+			cl.Patches[srcFile.Path()] = fp
+		case srcFile.Path() != dstFile.Path():
+			if e.ignored(srcFile.Path()) {
+				continue
+			}
+			cl.Added = append(cl.Added, dstFile.Path())
+			cl.Removed = append(cl.Removed, srcFile.Path())
+			cl.Renames = append(cl.Renames, Rename{From: srcFile.Path(), To: dstFile.Path()})
+			cl.Patches[dstFile.Path()] = fp
+			cl.Patches[srcFile.Path()] = fp
+		default:
+			if e.ignored(srcFile.Path()) {
+				continue
+			}
+			cl.Changed = append(cl.Changed, srcFile.Path())
+			cl.Patches[srcFile.Path()] = fp
+		}
+	}
+
+	e.Logger.V(1).Info("found changed files", "added", len(cl.Added), "removed", len(cl.Removed), "changed", len(cl.Changed))
+	return cl, nil
+}
@@ -0,0 +1,141 @@
+// Package diffblame computes the set of commits (and, optionally, the
+// per-line attribution) responsible for the changes between two points in a
+// git repository's history. It is the engine behind cmd/diffblame, but is
+// exported as a standalone package so that it can be embedded in other
+// tools such as CI annotators, code-review bots or IDE plugins.
+package diffblame
+
+import (
+	"io"
+	"path"
+	"runtime"
+	"sync"
+
+	"github.com/go-git/go-git/v5"
+	cgraph "github.com/go-git/go-git/v5/plumbing/format/commitgraph/v2"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/object/commitgraph"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"github.com/go-logr/logr"
+)
+
+// Engine computes diff-blame information for a single begin..end range (or,
+// with EndTips set, a begin..{end tips} range) of a repository.
+type Engine struct {
+	Repo *git.Repository
+
+	// Begin and End delimit the range to diff-blame. End is always
+	// considered an end point; EndTips, if non-empty, adds further end
+	// points (e.g. every ref in the repository, for -all-refs semantics).
+	Begin   *object.Commit
+	End     *object.Commit
+	EndTips []*object.Commit
+
+	// IgnorePaths excludes any path containing one of these substrings from
+	// the change list (e.g. "vendor/").
+	IgnorePaths []string
+
+	// RenameScore is the minimum similarity percentage (0-100) for two blobs
+	// to be considered a rename, both in the top-level begin..end diff and
+	// while following a path's history across renames.
+	RenameScore int
+
+	// ShowRenames, if set, records the renames crossed while following a
+	// path through history; see the Renames method.
+	ShowRenames bool
+
+	// Cache is consulted and populated with (commit, path) -> last commit
+	// that touched path at or before commit. It defaults to an in-memory
+	// cache; callers that want it to survive across runs can supply a
+	// NewFileLastCommitCache instead.
+	Cache LastCommitCache
+
+	// Jobs is the number of goroutines used to explore the branches of merge
+	// commits concurrently. A value <= 0 (the default) uses
+	// runtime.NumCPU().
+	Jobs int
+
+	Logger logr.Logger
+
+	nodeIndex       commitgraph.CommitNodeIndex
+	commitGraphFile io.Closer
+	renamesMu       sync.Mutex
+	renames         map[string][]string
+}
+
+// NewEngine returns an Engine configured with this package's defaults: a
+// rename score of 70, "vendor/" ignored, an in-memory last-commit cache and
+// a discarding logger.
+func NewEngine(repo *git.Repository, begin, end *object.Commit) *Engine {
+	return &Engine{
+		Repo:        repo,
+		Begin:       begin,
+		End:         end,
+		EndTips:     []*object.Commit{end},
+		IgnorePaths: []string{"vendor/"},
+		RenameScore: 70,
+		Cache:       NewMemoryLastCommitCache(),
+		Logger:      logr.Discard(),
+	}
+}
+
+func (e *Engine) endTips() []*object.Commit {
+	tips := []*object.Commit{e.End}
+	for _, tip := range e.EndTips {
+		if tip.Hash != e.End.Hash {
+			tips = append(tips, tip)
+		}
+	}
+	return tips
+}
+
+func (e *Engine) commitNodeIndex() commitgraph.CommitNodeIndex {
+	if e.nodeIndex == nil {
+		e.nodeIndex = e.loadCommitNodeIndex()
+	}
+	return e.nodeIndex
+}
+
+// loadCommitNodeIndex returns a CommitNodeIndex backed by the repository's
+// persisted commit-graph file (objects/info/commit-graph), when one exists:
+// that is what gives isAncestorOfBegin's generation-number comparison its
+// short-circuit over a full ancestry walk. Without one, every node reports
+// the same sentinel generation and the comparison never short-circuits, so
+// repositories that haven't had `git commit-graph write` run against them
+// fall back to resolving nodes straight from the object store instead.
+func (e *Engine) loadCommitNodeIndex() commitgraph.CommitNodeIndex {
+	fsStorer, ok := e.Repo.Storer.(*filesystem.Storage)
+	if !ok {
+		return commitgraph.NewObjectCommitNodeIndex(e.Repo.Storer)
+	}
+
+	file, err := fsStorer.Filesystem().Open(path.Join("objects", "info", "commit-graph"))
+	if err != nil {
+		return commitgraph.NewObjectCommitNodeIndex(e.Repo.Storer)
+	}
+
+	index, err := cgraph.OpenFileIndex(file)
+	if err != nil {
+		_ = file.Close()
+		return commitgraph.NewObjectCommitNodeIndex(e.Repo.Storer)
+	}
+
+	e.commitGraphFile = file
+	return commitgraph.NewGraphCommitNodeIndex(index, e.Repo.Storer)
+}
+
+func (e *Engine) jobsCount() int {
+	if e.Jobs > 0 {
+		return e.Jobs
+	}
+	return runtime.NumCPU()
+}
+
+func (e *Engine) ignored(path string) bool {
+	for _, ignore := range e.IgnorePaths {
+		if containsPath(path, ignore) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package diffblame
+
+import (
+	"fmt"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// RefTips returns the commit each ref in repo (plus HEAD) points at,
+// deduplicated by hash. It is a convenience for callers that want to build
+// an Engine.EndTips set covering every branch in a repository, mirroring the
+// semantics of `git log --all`.
+func RefTips(repo *git.Repository) ([]*object.Commit, error) {
+	seen := map[plumbing.Hash]bool{}
+	var tips []*object.Commit
+
+	addTip := func(hash plumbing.Hash) {
+		c, err := peelToCommit(repo, hash)
+		if err != nil || seen[c.Hash] {
+			return
+		}
+		seen[c.Hash] = true
+		tips = append(tips, c)
+	}
+
+	if head, err := repo.Head(); err == nil {
+		addTip(head.Hash())
+	}
+
+	refs, err := repo.References()
+	if err != nil {
+		return nil, fmt.Errorf("could not list references: %w", err)
+	}
+	if err := refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference {
+			return nil
+		}
+		addTip(ref.Hash())
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("could not enumerate references: %w", err)
+	}
+
+	return tips, nil
+}
+
+// peelToCommit resolves hash to the commit it ultimately points at,
+// following a chain of annotated tags (a tag can itself point at another
+// tag) until it reaches one. It errors if the chain bottoms out at
+// something other than a commit, e.g. a tag of a tree or a blob.
+func peelToCommit(repo *git.Repository, hash plumbing.Hash) (*object.Commit, error) {
+	for {
+		if c, err := repo.CommitObject(hash); err == nil {
+			return c, nil
+		}
+		tag, err := repo.TagObject(hash)
+		if err != nil {
+			return nil, fmt.Errorf("%q is neither a commit nor a tag: %w", hash.String(), err)
+		}
+		hash = tag.Target
+	}
+}
@@ -0,0 +1,77 @@
+package diffblame
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// TestRefTipsPeelsAnnotatedTags checks that a ref whose hash points at a tag
+// object (an annotated tag), rather than directly at a commit, is resolved
+// to the commit it tags instead of being silently dropped.
+func TestRefTipsPeelsAnnotatedTags(t *testing.T) {
+	repo, err := git.Init(memory.NewStorage(), memfs.New())
+	if err != nil {
+		t.Fatalf("could not init test repository: %v", err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("could not get worktree: %v", err)
+	}
+
+	sig := &object.Signature{Name: "test", Email: "test@example.com", When: time.Unix(0, 0)}
+	write := func(content string) {
+		f, err := wt.Filesystem.Create("tracked.txt")
+		if err != nil {
+			t.Fatalf("could not create tracked.txt: %v", err)
+		}
+		if _, err := f.Write([]byte(content)); err != nil {
+			t.Fatalf("could not write tracked.txt: %v", err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatalf("could not close tracked.txt: %v", err)
+		}
+		if _, err := wt.Add("tracked.txt"); err != nil {
+			t.Fatalf("could not stage tracked.txt: %v", err)
+		}
+	}
+
+	write("v1\n")
+	taggedHash, err := wt.Commit("v1", &git.CommitOptions{Author: sig})
+	if err != nil {
+		t.Fatalf("could not commit v1: %v", err)
+	}
+
+	// taggedHash is only a ref tip through the annotated tag below, not as
+	// any branch tip: the branch moves on to a second commit.
+	write("v2\n")
+	if _, err := wt.Commit("v2", &git.CommitOptions{Author: sig}); err != nil {
+		t.Fatalf("could not commit v2: %v", err)
+	}
+
+	if _, err := repo.CreateTag("v1.0.0", taggedHash, &git.CreateTagOptions{
+		Tagger:  sig,
+		Message: "v1.0.0",
+	}); err != nil {
+		t.Fatalf("could not create annotated tag: %v", err)
+	}
+
+	tips, err := RefTips(repo)
+	if err != nil {
+		t.Fatalf("RefTips failed: %v", err)
+	}
+
+	var found bool
+	for _, c := range tips {
+		if c.Hash == taggedHash {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("RefTips(%v) did not include the commit tagged by the annotated tag v1.0.0", tips)
+	}
+}
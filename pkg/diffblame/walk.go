@@ -0,0 +1,658 @@
+package diffblame
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/object/commitgraph"
+)
+
+type fileStatus uint8
+
+const (
+	fileStatusSeeking fileStatus = iota
+	fileStatusFound
+	fileStatusRemoved
+)
+
+// pathState tracks, for a single path being followed through history,
+// whether it has been found yet and the chain of later names it was renamed
+// from, if any were crossed while following it backwards (oldest crossing
+// first).
+type pathState struct {
+	status  fileStatus
+	renames []string
+}
+
+func copyStatuses(m map[string]*pathState) map[string]*pathState {
+	n := make(map[string]*pathState, len(m))
+	for k, v := range m {
+		cp := *v
+		n[k] = &cp
+	}
+	return n
+}
+
+// renameSubstitution records that, once a range over the owning statuses
+// map has finished, the entry at from should be replaced by state under to.
+// Go does not guarantee that a key inserted into a map mid-range is itself
+// produced by that range, so a detected rename can't swap statuses[from]
+// for statuses[to] in place; it has to be queued and applied afterwards.
+type renameSubstitution struct {
+	from  string
+	to    string
+	state *pathState
+}
+
+func applyRenames(statuses map[string]*pathState, subs []renameSubstitution) {
+	for _, s := range subs {
+		delete(statuses, s.from)
+		statuses[s.to] = s.state
+	}
+}
+
+// accumulator is invoked for every commit that the accumulation considers
+// relevant for the requested paths. Returning false stops the walk from
+// recursing further down the branch the commit was found on. Since the walk
+// runs with bounded concurrency (see Engine.Jobs), an accumulator may be
+// called from multiple goroutines at once and must guard any state it
+// closes over.
+type accumulator func(*object.Commit) (bool, error)
+
+// commitSet is a concurrency-safe set of commits, keyed by hash, built up by
+// an accumulator over the course of a (possibly parallel) walk.
+type commitSet struct {
+	mu      sync.Mutex
+	commits map[string]*object.Commit
+}
+
+func newCommitSet() *commitSet {
+	return &commitSet{commits: map[string]*object.Commit{}}
+}
+
+func (s *commitSet) add(c *object.Commit) {
+	s.mu.Lock()
+	s.commits[c.Hash.String()] = c
+	s.mu.Unlock()
+}
+
+func addAlways(set *commitSet) accumulator {
+	return func(c *object.Commit) (bool, error) {
+		set.add(c)
+		return true, nil
+	}
+}
+
+// addIfNotAncestor adds c to set unless it is an ancestor of one of the
+// given bases, i.e. unless its effect on the paths of interest is already
+// visible from one of those tips.
+func addIfNotAncestor(set *commitSet, bases []*object.Commit) accumulator {
+	return func(c *object.Commit) (bool, error) {
+		for _, base := range bases {
+			ancestry, err := c.IsAncestor(base)
+			if err != nil {
+				return false, fmt.Errorf("could not determine whether %q is an ancestor of %q: %w", c.Hash.String(), base.Hash.String(), err)
+			}
+			if ancestry {
+				return false, nil
+			}
+		}
+		set.add(c)
+		return true, nil
+	}
+}
+
+// seenSet is a concurrency-safe set of commit hashes already visited by a
+// walk, shared across the worker pool's goroutines so that a commit
+// reachable from more than one branch is only processed once.
+type seenSet struct {
+	mu sync.Mutex
+	m  map[string]bool
+}
+
+func newSeenSet() *seenSet {
+	return &seenSet{m: map[string]bool{}}
+}
+
+// testAndSet reports whether id had already been seen, marking it seen as a
+// side effect.
+func (s *seenSet) testAndSet(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.m[id] {
+		return true
+	}
+	s.m[id] = true
+	return false
+}
+
+// task is a unit of work for the walk's worker pool: explore the history
+// reachable from node, with statuses tracking which paths are still of
+// interest on this branch.
+type task struct {
+	node     commitgraph.CommitNode
+	statuses map[string]*pathState
+}
+
+// walker carries the per-call state for a single accumulation pass over an
+// Engine's history. It is shared read-only (besides its concurrency-safe
+// seen set) across the worker pool's goroutines.
+type walker struct {
+	e    *Engine
+	seen *seenSet
+}
+
+func (w *walker) commit(node commitgraph.CommitNode) (*object.Commit, error) {
+	c, err := node.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("could not load commit %q: %w", node.ID().String(), err)
+	}
+	return c, nil
+}
+
+func (w *walker) beginGeneration() (uint64, error) {
+	node, err := w.e.commitNodeIndex().Get(w.e.Begin.Hash)
+	if err != nil {
+		return 0, fmt.Errorf("could not look up commit-graph node for %q: %w", w.e.Begin.Hash.String(), err)
+	}
+	return node.Generation(), nil
+}
+
+// isAncestorOfBegin reports whether node is an ancestor of e.Begin. It uses
+// the commit-graph generation number to avoid the full ancestry walk
+// whenever possible: a node whose generation is strictly greater than
+// Begin's cannot be one of its ancestors.
+func (w *walker) isAncestorOfBegin(node commitgraph.CommitNode) (bool, error) {
+	beginGen, err := w.beginGeneration()
+	if err != nil {
+		return false, err
+	}
+	if node.Generation() > beginGen {
+		return false, nil
+	}
+
+	c, err := w.commit(node)
+	if err != nil {
+		return false, err
+	}
+	ancestor, err := c.IsAncestor(w.e.Begin)
+	if err != nil {
+		return false, fmt.Errorf("could not determine whether %q is an ancestor of %q: %w", node.ID().String(), w.e.Begin.Hash.String(), err)
+	}
+	return ancestor, nil
+}
+
+// detectRename reports whether path, present in child's tree but missing
+// from parent's tree, is the destination of a rename between the two. This
+// mirrors `git log --follow` and lets the walk keep tracking a file across a
+// rename boundary instead of treating it as removed.
+func (w *walker) detectRename(ctx context.Context, parent, child *object.Commit, path string) (string, bool, error) {
+	parentTree, err := parent.Tree()
+	if err != nil {
+		return "", false, fmt.Errorf("failed to find the tree object for commit %q: %w", parent.Hash.String(), err)
+	}
+	childTree, err := child.Tree()
+	if err != nil {
+		return "", false, fmt.Errorf("failed to find the tree object for commit %q: %w", child.Hash.String(), err)
+	}
+
+	diff, err := object.DiffTreeWithOptions(ctx, parentTree, childTree, &object.DiffTreeOptions{
+		DetectRenames: true,
+		RenameScore:   uint(w.e.RenameScore),
+	})
+	if err != nil {
+		return "", false, fmt.Errorf("failed to diff %q and %q while looking for renames: %w", parent.Hash.String(), child.Hash.String(), err)
+	}
+
+	patch, err := diff.Patch()
+	if err != nil {
+		return "", false, fmt.Errorf("failed to transform the diff into a list of patches: %w", err)
+	}
+
+	for _, fp := range patch.FilePatches() {
+		from, to := fp.Files()
+		if from == nil || to == nil {
+			continue
+		}
+		if to.Path() == path && from.Path() != path {
+			return from.Path(), true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// lastCommitForPath returns the value to cache as "the last commit that
+// touched path at or before current", given that path is present in
+// current's tree: current itself, unless its content for path is identical
+// to its single parent's, in which case path wasn't touched by current and
+// whatever is already known (or, failing that, the parent itself) is
+// returned instead.
+func (w *walker) lastCommitForPath(current *object.Commit, parentNode commitgraph.CommitNode, parent *object.Commit, path string) plumbing.Hash {
+	if parent != nil {
+		if parentFile, err := parent.File(path); err == nil {
+			if currentFile, err := current.File(path); err == nil && currentFile.Hash == parentFile.Hash {
+				if last, ok := w.e.Cache.Get(parentNode.ID(), path); ok {
+					return last
+				}
+				return parentNode.ID()
+			}
+		}
+	}
+	return current.Hash
+}
+
+// taskQueue is an unbounded FIFO of pending tasks shared by the worker pool.
+// Unlike a fixed-capacity channel, push never blocks, so a worker fanning
+// out a large merge commit's parents can never deadlock waiting for another
+// worker (busy doing the same thing) to free up buffer space.
+type taskQueue struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	items  []task
+	closed bool
+}
+
+func newTaskQueue() *taskQueue {
+	q := &taskQueue{}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *taskQueue) push(t task) {
+	q.mu.Lock()
+	q.items = append(q.items, t)
+	q.cond.Signal()
+	q.mu.Unlock()
+}
+
+// pop blocks until a task is available or the queue is closed, in which case
+// it returns false.
+func (q *taskQueue) pop() (task, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.items) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if len(q.items) == 0 {
+		return task{}, false
+	}
+	t := q.items[0]
+	q.items = q.items[1:]
+	return t, true
+}
+
+// close wakes up every goroutine blocked in pop, which is safe to call once
+// the caller knows the queue will never receive another push (i.e. once
+// every in-flight task has been accounted for).
+func (q *taskQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.cond.Broadcast()
+	q.mu.Unlock()
+}
+
+// accumulateFromTips explores history from every configured end tip using a
+// pool of e.Jobs goroutines pulling from a shared work queue, so that the
+// branches of merge commits are explored concurrently. A single seenSet is
+// shared across the whole pass so that commits reachable from more than one
+// tip or branch are only processed once. It stops queueing new work early if
+// shouldStop becomes true.
+func (w *walker) accumulateFromTips(ctx context.Context, statuses map[string]*pathState, acc accumulator, shouldStop func() bool) error {
+	w.seen = newSeenSet()
+
+	queue := newTaskQueue()
+	var pending sync.WaitGroup
+
+	var errMu sync.Mutex
+	var firstErr error
+	recordErr := func(err error) {
+		errMu.Lock()
+		defer errMu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	var workers sync.WaitGroup
+	for i := 0; i < w.e.jobsCount(); i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for {
+				t, ok := queue.pop()
+				if !ok {
+					return
+				}
+				if shouldStop == nil || !shouldStop() {
+					subtasks, err := w.accumulateOne(ctx, t.node, t.statuses, acc)
+					if err != nil {
+						recordErr(err)
+					} else if len(subtasks) > 0 {
+						pending.Add(len(subtasks))
+						for _, st := range subtasks {
+							queue.push(st)
+						}
+					}
+				}
+				pending.Done()
+			}
+		}()
+	}
+
+	w.e.Logger.V(1).Info("starting walk", "tips", len(w.e.endTips()), "paths", len(statuses), "jobs", w.e.jobsCount())
+
+	for _, tip := range w.e.endTips() {
+		if shouldStop != nil && shouldStop() {
+			break
+		}
+		node, err := w.e.commitNodeIndex().Get(tip.Hash)
+		if err != nil {
+			recordErr(err)
+			continue
+		}
+		pending.Add(1)
+		queue.push(task{node: node, statuses: copyStatuses(statuses)})
+	}
+
+	// Once every pushed task has been accounted for (pending.Wait returns),
+	// the queue is guaranteed empty: a task is only marked done after any
+	// subtasks it produced have themselves been pushed and counted. Closing
+	// it then just releases the workers blocked waiting for more work.
+	pending.Wait()
+	queue.close()
+	workers.Wait()
+
+	return firstErr
+}
+
+// accumulateOne walks the single-parent chain starting at current, applying
+// acc to every commit of interest, until it reaches a merge commit or a
+// commit with no parents. For a merge commit it returns one task per parent
+// branch that still has paths of interest and isn't already covered by
+// Engine.Begin's history, for the caller to queue for further exploration.
+func (w *walker) accumulateOne(ctx context.Context, current commitgraph.CommitNode, statuses map[string]*pathState, acc accumulator) ([]task, error) {
+	var prevCommit, currentCommit *object.Commit
+
+	for {
+		if w.seen.testAndSet(current.ID().String()) {
+			return nil, nil
+		}
+
+		var err error
+		currentCommit, err = w.commit(current)
+		if err != nil {
+			return nil, err
+		}
+
+		if current.NumParents() != 1 {
+			break
+		}
+
+		// Resolved up front (rather than where the chain advances below) so
+		// that it can also be consulted while deciding what to cache for
+		// paths found on currentCommit; a lookup failure is handled in the
+		// same "stop after this commit" way it always has been.
+		parentNode, parentErr := current.ParentNode(0)
+		var parentCommit *object.Commit
+		if parentErr == nil {
+			parentCommit, err = w.commit(parentNode)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		var process bool
+		var renames []renameSubstitution
+		for path, st := range statuses {
+			if st.status == fileStatusRemoved {
+				continue
+			}
+
+			if _, fileErr := currentCommit.File(path); fileErr != nil {
+				if fileErr != object.ErrFileNotFound {
+					return nil, fmt.Errorf("unexpected path error for %q on %q: %w", path, current.ID().String(), fileErr)
+				}
+
+				if st.status == fileStatusFound && prevCommit != nil {
+					from, ok, rerr := w.detectRename(ctx, currentCommit, prevCommit, path)
+					if rerr != nil {
+						return nil, rerr
+					}
+					if ok {
+						w.e.Logger.V(1).Info("detected rename", "commit", prevCommit.Hash.String(), "from", from, "to", path)
+						renames = append(renames, renameSubstitution{
+							from:  path,
+							to:    from,
+							state: &pathState{status: fileStatusFound, renames: append(append([]string{}, st.renames...), path)},
+						})
+						if w.e.ShowRenames {
+							w.e.recordRename(prevCommit, from, path)
+						}
+						process = true
+						continue
+					}
+				}
+
+				if st.status == fileStatusFound {
+					statuses[path] = &pathState{status: fileStatusRemoved, renames: st.renames}
+				}
+			} else {
+				statuses[path] = &pathState{status: fileStatusFound, renames: st.renames}
+				process = true
+				w.e.Cache.Put(current.ID(), path, w.lastCommitForPath(currentCommit, parentNode, parentCommit, path))
+			}
+		}
+		applyRenames(statuses, renames)
+
+		if process {
+			w.e.Logger.V(1).Info("commit touches tracked paths", "commit", currentCommit.Hash.String())
+			cont, err := acc(currentCommit)
+			if err != nil {
+				return nil, err
+			}
+			if !cont {
+				return nil, nil
+			}
+		}
+
+		prevCommit = currentCommit
+		if parentErr != nil {
+			return nil, nil
+		}
+		current = parentNode
+	}
+
+	var tasks []task
+	for idx := 0; idx < current.NumParents(); idx++ {
+		p, err := current.ParentNode(idx)
+		if err != nil {
+			return nil, fmt.Errorf("could not get parent %d of %q: %w", idx+1, current.ID().String(), err)
+		}
+
+		pCommit, err := w.commit(p)
+		if err != nil {
+			return nil, err
+		}
+
+		branchStatuses := copyStatuses(statuses)
+
+		var process bool
+		var renames []renameSubstitution
+		for path, st := range branchStatuses {
+			if st.status == fileStatusRemoved {
+				continue
+			}
+			if _, cached := w.e.Cache.Get(p.ID(), path); cached {
+				// A cache hit means path was confirmed present in p's tree by
+				// an earlier pass, the same fact pCommit.File(path) below
+				// establishes on a miss, so it must be treated the same way:
+				// the branch still needs to be queued.
+				process = true
+				continue
+			}
+
+			if _, fileErr := pCommit.File(path); fileErr == nil {
+				process = true
+				continue
+			} else if fileErr != object.ErrFileNotFound {
+				return nil, fmt.Errorf("unexpected path error for %q on %q: %w", path, p.ID().String(), fileErr)
+			}
+
+			if st.status == fileStatusSeeking {
+				process = true
+				continue
+			}
+
+			from, ok, rerr := w.detectRename(ctx, pCommit, currentCommit, path)
+			if rerr != nil {
+				return nil, rerr
+			}
+			if ok {
+				w.e.Logger.V(1).Info("detected rename", "commit", currentCommit.Hash.String(), "from", from, "to", path)
+				renames = append(renames, renameSubstitution{
+					from:  path,
+					to:    from,
+					state: &pathState{status: fileStatusFound, renames: append(append([]string{}, st.renames...), path)},
+				})
+				if w.e.ShowRenames {
+					w.e.recordRename(currentCommit, from, path)
+				}
+				process = true
+			}
+		}
+		applyRenames(branchStatuses, renames)
+
+		if !process {
+			continue
+		}
+		ancestor, err := w.isAncestorOfBegin(p)
+		if err != nil {
+			return nil, err
+		}
+		if ancestor {
+			w.e.Logger.V(1).Info("skipping branch, already covered by begin", "commit", p.ID().String())
+			continue
+		}
+
+		w.e.Logger.V(1).Info("queueing branch", "commit", p.ID().String())
+		tasks = append(tasks, task{node: p, statuses: branchStatuses})
+	}
+	return tasks, nil
+}
+
+// recordRename records, for commit's hash, the "from -> to" rename that was
+// crossed while walking past it. It backs ShowRenames; callers can read it
+// back via Engine.Renames.
+func (e *Engine) recordRename(commit *object.Commit, from, to string) {
+	e.renamesMu.Lock()
+	defer e.renamesMu.Unlock()
+	if e.renames == nil {
+		e.renames = map[string][]string{}
+	}
+	e.renames[commit.Hash.String()] = append(e.renames[commit.Hash.String()], from+" -> "+to)
+}
+
+// Renames returns the renames that were crossed while walking past commit,
+// when ShowRenames is set.
+func (e *Engine) Renames(commit *object.Commit) []string {
+	e.renamesMu.Lock()
+	defer e.renamesMu.Unlock()
+	return e.renames[commit.Hash.String()]
+}
+
+func statusesFor(paths []string, status fileStatus) map[string]*pathState {
+	statuses := make(map[string]*pathState, len(paths))
+	for _, path := range paths {
+		statuses[path] = &pathState{status: status}
+	}
+	return statuses
+}
+
+// Commits returns every commit that introduced one of the changes in cl,
+// sorted by committer date.
+func (e *Engine) Commits(ctx context.Context, cl ChangeList) ([]*object.Commit, error) {
+	var mu sync.Mutex
+	var commits []*object.Commit
+	err := e.Walk(ctx, cl, func(c *object.Commit) error {
+		mu.Lock()
+		commits = append(commits, c)
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(commits, func(i, j int) bool {
+		return commits[i].Committer.When.Before(commits[j].Committer.When)
+	})
+	return commits, nil
+}
+
+// Walk streams every commit that introduced one of the changes in cl to fn,
+// stopping (and returning fn's error) the first time fn returns one. Because
+// the walk explores the branches of merge commits with bounded concurrency
+// (see Engine.Jobs), fn may be called from multiple goroutines at once and
+// must be safe for concurrent use.
+func (e *Engine) Walk(ctx context.Context, cl ChangeList, fn func(*object.Commit) error) error {
+	w := &walker{e: e}
+	set := newCommitSet()
+
+	var mu sync.Mutex
+	visited := map[string]bool{}
+	var fnErr error
+	shouldStop := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return fnErr != nil
+	}
+	wrap := func(base accumulator) accumulator {
+		return func(c *object.Commit) (bool, error) {
+			cont, err := base(c)
+			if err != nil || !cont {
+				return cont, err
+			}
+
+			mu.Lock()
+			if visited[c.Hash.String()] {
+				mu.Unlock()
+				return true, nil
+			}
+			visited[c.Hash.String()] = true
+			mu.Unlock()
+
+			if err := fn(c); err != nil {
+				mu.Lock()
+				if fnErr == nil {
+					fnErr = err
+				}
+				mu.Unlock()
+				return false, nil
+			}
+			return true, nil
+		}
+	}
+
+	if err := w.accumulateFromTips(ctx, statusesFor(cl.Added, fileStatusFound), wrap(addAlways(set)), shouldStop); err != nil {
+		return err
+	}
+	if fnErr != nil {
+		return fnErr
+	}
+
+	if err := w.accumulateFromTips(ctx, statusesFor(cl.Removed, fileStatusSeeking), wrap(addIfNotAncestor(set, []*object.Commit{e.Begin})), shouldStop); err != nil {
+		return err
+	}
+	if fnErr != nil {
+		return fnErr
+	}
+
+	if err := w.accumulateFromTips(ctx, statusesFor(cl.Changed, fileStatusFound), wrap(addIfNotAncestor(set, []*object.Commit{e.Begin})), shouldStop); err != nil {
+		return err
+	}
+	return fnErr
+}